@@ -0,0 +1,41 @@
+package blockchain
+
+import "github.com/boltdb/bolt"
+
+// EnsureUTXOConsistency 在节点启动时检查 chainstate 的 tipKey 标记是否
+// 与链的真实尖端一致：Update 每次成功都会把 tipKey 写成新区块的哈希，
+// 正常关闭时两者应当相同。Update 在同一个 bolt 事务里写输出和 tipKey，
+// 但链尖标记 "l" 与 UTXO 集合是分两次写的，只有在不一致时（例如上次
+// 进程在这两次写入之间被杀掉）才会触发一次完整的
+// Reindex，避免每次启动都做一次全链扫描。
+//
+// 调用顺序：应当在打开 Blockchain 之后、StartServer 开始处理任何网络
+// 消息之前调用一次；内存池的 net.LoadMempool 依赖这之后的 UTXO 集合
+// 才能正确核算每笔交易的手续费，因此要排在它前面。
+func EnsureUTXOConsistency(bc *Blockchain, utxoSet *UTXOSet) error {
+	storedTip, err := readUTXOTip(bc)
+	if err != nil {
+		return err
+	}
+
+	if storedTip != nil && string(storedTip) == string(bc.tip) {
+		return nil
+	}
+
+	return utxoSet.Reindex()
+}
+
+func readUTXOTip(bc *Blockchain) ([]byte, error) {
+	var tip []byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(utxoBucket))
+		if bucket == nil {
+			return nil
+		}
+		tip = bucket.Get([]byte(tipKey))
+		return nil
+	})
+
+	return tip, err
+}
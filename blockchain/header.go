@@ -0,0 +1,27 @@
+package blockchain
+
+// BlockHeader 只携带校验一个区块的工作量证明、确定它在链上位置所需的
+// 字段，不带任何交易。SPV对等节点和headers-first同步交换的就是这个，
+// 而不是完整区块。
+type BlockHeader struct {
+	Hash          []byte
+	PrevBlockHash []byte
+	MerkleRoot    []byte
+	Timestamp     int64
+	Bits          int
+	Nonce         int
+	Height        int
+}
+
+// Header 从一个完整区块中提取出它的头部。
+func (b *Block) Header() BlockHeader {
+	return BlockHeader{
+		Hash:          b.Hash,
+		PrevBlockHash: b.PrevBlockHash,
+		MerkleRoot:    b.HashTransactions(),
+		Timestamp:     b.Timestamp,
+		Bits:          b.Bits,
+		Nonce:         b.Nonce,
+		Height:        b.Height,
+	}
+}
@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// HeaderChain 在headers-first初始区块下载期间维护链的纯头部视图：校验
+// 每个头部的工作量证明，并沿每条分支累加工作量，这样节点能在下载任何
+// 一个完整区块体之前先选出最优的头部链。
+type HeaderChain struct {
+	byHash map[string]BlockHeader
+	work   map[string]*big.Int
+	tip    []byte
+}
+
+// NewHeaderChain 用创世区块的头部给头部链播种，创世头部无条件信任（它
+// 没有父头部可供校验）。
+func NewHeaderChain(genesis BlockHeader) *HeaderChain {
+	hc := &HeaderChain{
+		byHash: make(map[string]BlockHeader),
+		work:   make(map[string]*big.Int),
+	}
+	hc.byHash[string(genesis.Hash)] = genesis
+	hc.work[string(genesis.Hash)] = workForBits(genesis.Bits)
+	hc.tip = genesis.Hash
+	return hc
+}
+
+// Add 用 h 的父头部（必须已经存在）校验并记录 h。当 h 延伸（或反超）了
+// 当前最优链尖时返回新的链尖哈希，否则返回 nil。
+func (hc *HeaderChain) Add(h BlockHeader) ([]byte, error) {
+	if _, exists := hc.byHash[string(h.Hash)]; exists {
+		return nil, nil
+	}
+
+	prevWork, ok := hc.work[string(h.PrevBlockHash)]
+	if !ok {
+		return nil, errors.New("headerchain: unknown parent header")
+	}
+
+	if !ValidateHeaderPoW(h) {
+		return nil, errors.New("headerchain: header fails proof-of-work check")
+	}
+
+	cumWork := new(big.Int).Add(prevWork, workForBits(h.Bits))
+	hc.byHash[string(h.Hash)] = h
+	hc.work[string(h.Hash)] = cumWork
+
+	if cumWork.Cmp(hc.work[string(hc.tip)]) > 0 {
+		hc.tip = h.Hash
+		return h.Hash, nil
+	}
+
+	return nil, nil
+}
+
+// Has 判断某个头部是否已经被记录过。
+func (hc *HeaderChain) Has(hash []byte) bool {
+	_, ok := hc.byHash[string(hash)]
+	return ok
+}
+
+// Tip 返回当前已知最优头部链链尖的哈希。
+func (hc *HeaderChain) Tip() []byte {
+	return hc.tip
+}
+
+// Header 按哈希查找之前记录过的头部。
+func (hc *HeaderChain) Header(hash []byte) (BlockHeader, bool) {
+	h, ok := hc.byHash[string(hash)]
+	return h, ok
+}
+
+// ValidateHeaderPoW 只用头部自身的字段（不需要区块的交易，头部里已经带
+// 着梅克尔根）重新计算哈希，核对它是否满足 Bits 隐含的难度目标。
+func ValidateHeaderPoW(h BlockHeader) bool {
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-h.Bits))
+
+	data := bytes.Join(
+		[][]byte{h.PrevBlockHash, h.MerkleRoot, IntToHex(h.Timestamp), IntToHex(int64(h.Bits)), IntToHex(int64(h.Nonce))},
+		[]byte{},
+	)
+	hash := sha256.Sum256(data)
+
+	hashInt := new(big.Int).SetBytes(hash[:])
+	return hashInt.Cmp(target) == -1
+}
+
+// maxTarget 是最低难度（bits = 1）对应的目标值，换算"工作量"时作分子。
+var maxTarget = new(big.Int).Lsh(big.NewInt(1), 255)
+
+// workForBits 把难度目标换算成近似的工作量（前导零位越多，目标值越
+// 小，工作量越大），这样不同难度的分支之间的累计工作量才能比较。
+func workForBits(bits int) *big.Int {
+	target := new(big.Int).Lsh(big.NewInt(1), uint(256-bits))
+	if target.Sign() == 0 {
+		return big.NewInt(1)
+	}
+	return new(big.Int).Div(maxTarget, target)
+}
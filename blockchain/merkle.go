@@ -0,0 +1,162 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// MerkleTree 是由交易ID两两配对哈希构建出的完全二叉树（奇数个叶子时
+// 复制最后一个叶子），RootNode.Data 即区块头里存放的梅克尔根。
+type MerkleTree struct {
+	RootNode *MerkleNode
+}
+
+// MerkleNode 是梅克尔树的一个节点；叶子节点的 Left/Right 为 nil，
+// 此时 Data 传入的是交易ID本身，节点会对它做一次哈希得到叶子哈希。
+type MerkleNode struct {
+	Left  *MerkleNode
+	Right *MerkleNode
+	Data  []byte
+}
+
+// NewMerkleNode 叶子节点对 data（交易ID）做一次哈希；内部节点把左右
+// 孩子的哈希拼接后再哈希一次。
+func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
+	node := &MerkleNode{Left: left, Right: right}
+
+	if left == nil && right == nil {
+		node.Data = sha256Sum(data)
+	} else {
+		node.Data = hashPair(left.Data, right.Data)
+	}
+
+	return node
+}
+
+// NewMerkleTree 用一组交易ID（叶子层）构建梅克尔树。某一层节点数为
+// 奇数时，复制最后一个节点来配对，这是比特币的标准做法。
+func NewMerkleTree(txIDs [][]byte) *MerkleTree {
+	if len(txIDs) == 0 {
+		return &MerkleTree{RootNode: NewMerkleNode(nil, nil, []byte{})}
+	}
+
+	leaves := make([][]byte, len(txIDs))
+	copy(leaves, txIDs)
+	if len(leaves)%2 != 0 {
+		leaves = append(leaves, leaves[len(leaves)-1])
+	}
+
+	var nodes []*MerkleNode
+	for _, id := range leaves {
+		nodes = append(nodes, NewMerkleNode(nil, nil, id))
+	}
+
+	for len(nodes) > 1 {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+
+		var level []*MerkleNode
+		for i := 0; i < len(nodes); i += 2 {
+			level = append(level, NewMerkleNode(nodes[i], nodes[i+1], nil))
+		}
+		nodes = level
+	}
+
+	return &MerkleTree{RootNode: nodes[0]}
+}
+
+// HashTransactions 返回本区块交易集合的梅克尔根，存进区块头参与PoW
+// 哈希，并被 ValidateBlock 间接校验。
+func (b *Block) HashTransactions() []byte {
+	txIDs := make([][]byte, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		txIDs[i] = tx.ID
+	}
+	return NewMerkleTree(txIDs).RootNode.Data
+}
+
+// MerkleProofStep 是梅克尔分支上的一个兄弟节点：IsRight 表示该兄弟节点
+// 位于当前节点的右侧（拼接时 current||sibling），否则位于左侧。
+type MerkleProofStep struct {
+	Hash    []byte
+	IsRight bool
+}
+
+// MerkleProof 返回 txID 在本区块梅克尔树中的分支证明：从叶子到根依次
+// 需要拼接哈希的兄弟节点哈希和各自方向。SPV 节点凭这份证明即可独立
+// 重算出梅克尔根，和区块头里的根比对来确认某笔交易确实打包进了这个
+// 区块，而不必下载区块里的全部交易。
+func (b *Block) MerkleProof(txID []byte) ([]MerkleProofStep, bool) {
+	leafIdx := -1
+	txIDs := make([][]byte, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		txIDs[i] = tx.ID
+		if bytes.Equal(tx.ID, txID) {
+			leafIdx = i
+		}
+	}
+	if leafIdx == -1 {
+		return nil, false
+	}
+
+	if len(txIDs)%2 != 0 {
+		txIDs = append(txIDs, txIDs[len(txIDs)-1])
+	}
+
+	level := make([][]byte, len(txIDs))
+	for i, id := range txIDs {
+		level[i] = sha256Sum(id)
+	}
+	idx := leafIdx
+
+	var proof []MerkleProofStep
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+
+		var siblingIdx int
+		var isRight bool
+		if idx%2 == 0 {
+			siblingIdx, isRight = idx+1, true
+		} else {
+			siblingIdx, isRight = idx-1, false
+		}
+		proof = append(proof, MerkleProofStep{Hash: level[siblingIdx], IsRight: isRight})
+
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, hashPair(level[i], level[i+1]))
+		}
+		level = next
+		idx = idx / 2
+	}
+
+	return proof, true
+}
+
+// VerifyMerkleProof 用一份 MerkleProof 把 txID 的哈希逐步拼到根，
+// 并与 merkleRoot 比对。SPV 节点用它确认 merkleblock 消息里声称的
+// 某笔交易确实属于该区块。
+func VerifyMerkleProof(txID []byte, proof []MerkleProofStep, merkleRoot []byte) bool {
+	current := sha256Sum(txID)
+	for _, step := range proof {
+		if step.IsRight {
+			current = hashPair(current, step.Hash)
+		} else {
+			current = hashPair(step.Hash, current)
+		}
+	}
+	return bytes.Equal(current, merkleRoot)
+}
+
+func sha256Sum(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+func hashPair(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+	return hash[:]
+}
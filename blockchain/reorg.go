@@ -0,0 +1,105 @@
+package blockchain
+
+import "bytes"
+
+// findCommonAncestor 从两个分支尖端各自向父区块回溯，直到两条路径
+// 相遇，返回共同祖先的哈希以及从各自尖端到祖先（不含祖先）的区块哈希
+// 列表：branchA 是要断开的，branchB 是要接上的，均按"由尖端到祖先"的
+// 顺序排列。
+func findCommonAncestor(bc *Blockchain, tipA, tipB []byte) (ancestor []byte, branchA, branchB [][]byte, err error) {
+	seen := map[string]bool{}
+
+	cursor := tipA
+	for len(cursor) > 0 {
+		seen[string(cursor)] = true
+		b, getErr := bc.GetBlock(cursor)
+		if getErr != nil {
+			break
+		}
+		branchA = append(branchA, cursor)
+		cursor = b.PrevBlockHash
+	}
+
+	cursor = tipB
+	for len(cursor) > 0 {
+		if seen[string(cursor)] {
+			ancestor = cursor
+			break
+		}
+		b, getErr := bc.GetBlock(cursor)
+		if getErr != nil {
+			break
+		}
+		branchB = append(branchB, cursor)
+		cursor = b.PrevBlockHash
+	}
+
+	if ancestor == nil {
+		return nil, nil, nil, errNoCommonAncestor
+	}
+
+	// 裁掉 branchA 里祖先及其之后的部分，只保留需要断开的区块
+	for i, h := range branchA {
+		if bytes.Equal(h, ancestor) {
+			branchA = branchA[:i]
+			break
+		}
+	}
+
+	return ancestor, branchA, branchB, nil
+}
+
+// Reorganize 把链尖从 currentTip 切换到 newTip：currentTip 所在分支上、
+// 高于共同祖先的区块会被断开（依次从 UTXO 集合中撤销它们的效果），
+// newTip 所在分支上的区块则按祖先到尖端的顺序重新连接并增量更新
+// UTXOSet。调用方需确保 newTip 所在分支的权重（长度/累计工作量）
+// 确实超过 currentTip 才触发重组。
+//
+// 绝大多数调用其实只是把链尖往后延一个区块，并非真正的分支切换；
+// 这种情况下直接判断 newTip 的父区块就是 currentTip，跳过
+// findCommonAncestor 的整链回溯，否则每接一个区块都要走一遍O(链高)的
+// 查找，重新背上 chunk0-4 已经去掉的那种随链增长而变差的开销。
+func Reorganize(bc *Blockchain, utxoSet *UTXOSet, newTip []byte) error {
+	currentTip := bc.tip
+
+	if newBlock, err := bc.GetBlock(newTip); err == nil && bytes.Equal(newBlock.PrevBlockHash, currentTip) {
+		if err := utxoSet.Update(&newBlock); err != nil {
+			return err
+		}
+		return bc.SetTip(newTip)
+	}
+
+	_, disconnect, connect, err := findCommonAncestor(bc, currentTip, newTip)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range disconnect {
+		block, err := bc.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+		if err := utxoSet.Disconnect(&block); err != nil {
+			return err
+		}
+	}
+
+	// connect 当前是"尖端到祖先"顺序，需要反转成"祖先到尖端"再应用
+	for i := len(connect) - 1; i >= 0; i-- {
+		block, err := bc.GetBlock(connect[i])
+		if err != nil {
+			return err
+		}
+		if err := utxoSet.Update(&block); err != nil {
+			return err
+		}
+	}
+
+	return bc.SetTip(newTip)
+}
+
+var errNoCommonAncestor = blockchainError("reorg: no common ancestor found between branches")
+
+type blockchainError string
+
+func (e blockchainError) Error() string { return string(e) }
@@ -0,0 +1,22 @@
+package blockchain
+
+import "github.com/boltdb/bolt"
+
+// blocksBucket 是存放区块本体、以"l" -> 最新区块哈希 记录链尖的桶。
+const blocksBucket = "blocks"
+
+// SetTip 把链尖切换到 hash 指向的区块（要求该区块已经存在于 blocksBucket
+// 中），同时更新内存里的 tip 字段。Reorganize 在把胜出分支重新接上之后
+// 用它完成切换；正常的单区块追加由 AddBlock 自己维护 tip，无需调用它。
+func (bc *Blockchain) SetTip(hash []byte) error {
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blocksBucket))
+		return bucket.Put([]byte("l"), hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	bc.tip = hash
+	return nil
+}
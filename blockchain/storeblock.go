@@ -0,0 +1,14 @@
+package blockchain
+
+import "github.com/boltdb/bolt"
+
+// StoreBlock 把一个区块写进 blocksBucket，但不触碰链尖标记 "l"。
+// 用于落地侧链区块：它们需要能被 GetBlock 查到（好让后续区块的
+// PrevBlockHash 链接得上、也好让 Reorganize 在反超时找到它们），
+// 但在被证明赢得最长链之前不应该成为当前链尖。
+func (bc *Blockchain) StoreBlock(block *Block) error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blocksBucket))
+		return bucket.Put(block.Hash, block.Serialize())
+	})
+}
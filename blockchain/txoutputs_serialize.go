@@ -0,0 +1,36 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+)
+
+// SerializeOutputs 把一组 UTXO 编码成可以存进 chainstate 桶的字节串。
+func SerializeOutputs(outs *TXOutputs) []byte {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	if err := enc.Encode(outs); err != nil {
+		log.Panic(err)
+	}
+
+	return buff.Bytes()
+}
+
+// DeserializeOutputs 把 chainstate 桶里取出的字节串还原成 TXOutputs。
+// 传入 nil（键不存在）时返回一个空的 TXOutputs，方便调用方直接 append。
+func DeserializeOutputs(data []byte) *TXOutputs {
+	if data == nil {
+		return &TXOutputs{}
+	}
+
+	var outputs TXOutputs
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&outputs); err != nil {
+		log.Panic(err)
+	}
+
+	return &outputs
+}
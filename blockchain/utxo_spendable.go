@@ -0,0 +1,24 @@
+package blockchain
+
+import "blockchain_go/transaction"
+
+// IsSpendable 判断某笔交易的第 voutIdx 个输出当前是否还在 UTXO 集合中，
+// 即既存在又尚未被花费。Update/Reindex 维护的 chainstate 数据保证了
+// 已花费的输出会被整条或部分移除，因此这里只需要做一次存在性查询。
+func (u UTXOSet) IsSpendable(txID []byte, voutIdx int) bool {
+	outs, err := u.FindUTXOByTxID(txID)
+	if err != nil {
+		return false
+	}
+	return voutIdx >= 0 && voutIdx < len(outs.Outputs)
+}
+
+// FindOutput 返回某笔交易第 voutIdx 个输出的内容，前提是它当前仍未被
+// 花费；用于计算引用它的交易愿意支付多少手续费。
+func (u UTXOSet) FindOutput(txID []byte, voutIdx int) (*transaction.TXOutput, bool) {
+	outs, err := u.FindUTXOByTxID(txID)
+	if err != nil || voutIdx < 0 || voutIdx >= len(outs.Outputs) {
+		return nil, false
+	}
+	return &outs.Outputs[voutIdx], true
+}
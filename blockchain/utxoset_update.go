@@ -0,0 +1,127 @@
+package blockchain
+
+import (
+	"blockchain_go/transaction"
+
+	"github.com/boltdb/bolt"
+)
+
+// utxoBucket 是 chainstate 中存放未花费交易输出的桶，键直接是 txID
+// （不带 "c" 之类的前缀），值为该笔交易当前仍未花费的输出集合
+// （TXOutputs 的序列化形式）。
+const utxoBucket = "chainstate"
+
+// tipKey 是 chainstate 桶里记录"UTXO 集合对应链尖"的标记键，
+// 供启动时比对 bc.GetBestHeight() 的真实尖端，判断是否需要重新索引。
+const tipKey = "B"
+
+// TXOutputs 包装某笔交易当前仍未被花费的输出列表。
+type TXOutputs struct {
+	Outputs []transaction.TXOutput
+}
+
+// Update 在一个新区块被接受进主链时增量维护 UTXO 集合：对区块里的每笔
+// 交易，先把它消费掉的输入从对应的 TXOutputs 里摘掉（一笔交易的全部
+// 输出都被花光后整条记录删除），再把它自己的新输出整条写入；最后把
+// tipKey 更新为本区块哈希，供下次启动时做一致性检查。
+//
+// 相比 Reindex() 从头扫描整条链重建 UTXO 集合，Update 的开销只与新区块
+// 里的交易数量成正比。
+func (u UTXOSet) Update(block *Block) error {
+	db := u.Blockchain.db
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(utxoBucket))
+
+		for _, txn := range block.Transactions {
+			if !txn.IsCoinbase() {
+				for _, vin := range txn.Vin {
+					updatedOuts := TXOutputs{}
+					outsBytes := bucket.Get(vin.Txid)
+					outs := DeserializeOutputs(outsBytes)
+
+					for outIdx, out := range outs.Outputs {
+						if outIdx != vin.Vout {
+							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
+						}
+					}
+
+					if len(updatedOuts.Outputs) == 0 {
+						if err := bucket.Delete(vin.Txid); err != nil {
+							return err
+						}
+					} else {
+						if err := bucket.Put(vin.Txid, SerializeOutputs(&updatedOuts)); err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+			newOutputs := TXOutputs{Outputs: txn.Vout}
+			if err := bucket.Put(txn.ID, SerializeOutputs(&newOutputs)); err != nil {
+				return err
+			}
+		}
+
+		return bucket.Put([]byte(tipKey), block.Hash)
+	})
+}
+
+// Disconnect 撤销一个被重组切出主链的区块对 UTXO 集合的效果：把它产生
+// 的输出整条删除，再把它消费掉的那些输入重新放回未花费状态。
+// 由于 chainstate 并不单独保存"被花费前的完整输出集合"，重新放回的
+// 输出需要从被花费交易本身取得，因此这里依赖 bc.FindTransaction 读取
+// 原始交易数据。
+func (u UTXOSet) Disconnect(block *Block) error {
+	db := u.Blockchain.db
+	bc := u.Blockchain
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(utxoBucket))
+
+		for _, txn := range block.Transactions {
+			if err := bucket.Delete(txn.ID); err != nil {
+				return err
+			}
+
+			if txn.IsCoinbase() {
+				continue
+			}
+
+			for _, vin := range txn.Vin {
+				prevTx, err := bc.FindTransaction(vin.Txid)
+				if err != nil {
+					return err
+				}
+
+				updatedOuts := TXOutputs{}
+				outsBytes := bucket.Get(vin.Txid)
+				if outsBytes != nil {
+					updatedOuts = *DeserializeOutputs(outsBytes)
+				}
+				updatedOuts.Outputs = append(updatedOuts.Outputs, prevTx.Vout[vin.Vout])
+
+				if err := bucket.Put(vin.Txid, SerializeOutputs(&updatedOuts)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// FindUTXOByTxID 返回某笔交易当前仍未被花费的输出集合。
+func (u UTXOSet) FindUTXOByTxID(txID []byte) (*TXOutputs, error) {
+	var outs *TXOutputs
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(utxoBucket))
+		outs = DeserializeOutputs(bucket.Get(txID))
+		return nil
+	})
+
+	return outs, err
+}
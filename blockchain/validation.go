@@ -0,0 +1,132 @@
+package blockchain
+
+import (
+	"blockchain_go/transaction"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 区块体积上限，超过此值的区块在验证阶段直接拒绝，防止畸形/超大区块占满内存
+const MaxBlockSize = 1 << 20 // 1 MiB
+
+// 允许区块时间戳领先本地时钟的最大偏差，超过视为无效
+const maxTimeDrift = 2 * time.Hour
+
+// ValidateBlock 在把一个外部区块交给 AddBlock 之前对其做完整性校验，
+// 覆盖工作量证明、梅克尔根、时间戳范围、区块体积、coinbase 结构/补贴
+// 以及区块内每一笔非 coinbase 交易的签名与 UTXO 可用性。
+//
+// bc 用于校验交易签名以及构造 UTXOSet 核对输入是否可花费；补贴校验
+// 只看 coinbase 自身，不查询父区块高度。
+func ValidateBlock(bc *Blockchain, block *Block) error {
+	if block == nil {
+		return errors.New("validation: nil block")
+	}
+
+	if len(block.Serialize()) > MaxBlockSize {
+		return errors.New("validation: block exceeds MaxBlockSize")
+	}
+
+	if block.Timestamp > time.Now().Add(maxTimeDrift).Unix() {
+		return errors.New("validation: block timestamp too far in the future")
+	}
+
+	// pow.Validate() 会用 block.HashTransactions() 重新计算梅克尔根参与哈希，
+	// 因此顺带校验了梅克尔根与当前交易集合一致；这里不需要单独再算一遍。
+	pow := NewProofOfWork(block)
+	if !pow.Validate() {
+		return errors.New("validation: proof-of-work does not satisfy target, or merkle root does not match transactions")
+	}
+
+	if len(block.Transactions) == 0 {
+		return errors.New("validation: block carries no transactions")
+	}
+
+	if err := validateCoinbase(block); err != nil {
+		return err
+	}
+
+	utxoSet := UTXOSet{bc}
+	spentInBlock := make(map[string]bool)
+	for _, tx := range block.Transactions[1:] {
+		if tx.IsCoinbase() {
+			return errors.New("validation: coinbase transaction found outside position 0")
+		}
+		for _, in := range tx.Vin {
+			if spentInBlock[outpointKey(in.Txid, in.Vout)] {
+				return errors.New("validation: transaction double-spends an outpoint already spent earlier in this block")
+			}
+		}
+		if err := ValidateTransaction(bc, &utxoSet, tx); err != nil {
+			return err
+		}
+		for _, in := range tx.Vin {
+			spentInBlock[outpointKey(in.Txid, in.Vout)] = true
+		}
+	}
+
+	return nil
+}
+
+// outpointKey 把一个输出的引用（交易ID+下标）编码成可比较的字符串键，
+// 供 ValidateBlock 在单个区块内跟踪"这个输出已经被本区块里更早的交易
+// 花掉了"，chainstate 里的 UTXO 集合要等整个区块应用完才会反映这一点，
+// 靠它自己的 IsSpendable 查不出同一区块内的重复花费。
+func outpointKey(txID []byte, voutIdx int) string {
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(txID), voutIdx)
+}
+
+// blockReward 是本链付给挖出区块者的补贴，需与 transaction.NewCoinbaseTX
+// 里铸造 coinbase 输出时用的金额保持一致。这条链不实现减半，补贴金额
+// 恒定，因此这里不是Bitcoin主网的减半曲线，而是这条链自己的、唯一的
+// 奖励规则。
+const blockReward = 10
+
+// validateCoinbase 检查区块第一笔交易是合法的 coinbase，且其补贴不超过
+// blockReward。
+func validateCoinbase(block *Block) error {
+	cb := block.Transactions[0]
+	if !cb.IsCoinbase() {
+		return errors.New("validation: first transaction is not coinbase")
+	}
+	if len(cb.Vout) != 1 {
+		return errors.New("validation: coinbase must have exactly one output")
+	}
+	if cb.Vout[0].Value > blockReward {
+		return errors.New("validation: coinbase pays more than the allowed subsidy")
+	}
+	return nil
+}
+
+// ValidateTransaction 重新校验一笔非 coinbase 交易：签名必须对引用的前序
+// 输出有效，每个输入引用的 UTXO 在 chainstate 里当前仍然可花费（未被链上
+// 其它交易提前花掉），且输入总值不小于输出总值——否则这笔交易就是在凭空
+// 铸币。同一区块内更早的交易花掉的输出它查不出来，这由 ValidateBlock
+// 用 outpointKey 另行检查。
+func ValidateTransaction(bc *Blockchain, utxoSet *UTXOSet, tx *transaction.Transaction) error {
+	if !bc.VerifyTransactionSig(tx) {
+		return errors.New("validation: invalid transaction signature")
+	}
+
+	var inputTotal int
+	for _, in := range tx.Vin {
+		out, ok := utxoSet.FindOutput(in.Txid, in.Vout)
+		if !ok {
+			return errors.New("validation: input references an unavailable UTXO")
+		}
+		inputTotal += out.Value
+	}
+
+	var outputTotal int
+	for _, out := range tx.Vout {
+		outputTotal += out.Value
+	}
+
+	if inputTotal < outputTotal {
+		return errors.New("validation: transaction outputs exceed inputs")
+	}
+
+	return nil
+}
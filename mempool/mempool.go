@@ -0,0 +1,200 @@
+// Package mempool 实现节点的未确认交易池：取代过去 net 包里那个裸的
+// map[string]Transaction，按手续费率排序、限制总体积与单笔交易的祖先
+// 体积，超限时优先逐出手续费率最低的交易。
+package mempool
+
+import (
+	"blockchain_go/blockchain"
+	"blockchain_go/transaction"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// maxBytes 是内存池允许占用的总体积上限，超出时逐出手续费率最低的
+// 交易直到降回这个上限以下。
+const maxBytes = 300 * 1000 * 1000 // 300 MB
+
+// maxAncestorCount/maxAncestorSizeBytes 限制单笔交易连同它在池内尚未
+// 确认的祖先交易一起的数量与体积，避免一条长长的未确认交易链占用过多
+// 打包与重算资源。对应 Bitcoin Core 的 25 笔 / 101 kvB 默认值。
+const (
+	maxAncestorCount     = 25
+	maxAncestorSizeBytes = 101 * 1000 // 101 kvB
+)
+
+// Entry 记录内存池里一笔交易的统计信息，供排序、逐出和
+// SelectBlockTemplate 使用。AncestorFee/AncestorSize/AncestorCount 把
+// 这笔交易连同它在池内的未确认祖先一起计算在内，这样打包时能按"整条
+// 祖先链的手续费率"取舍，而不是只看这一笔交易自己的手续费率。
+type Entry struct {
+	Tx            *transaction.Transaction
+	Fee           int
+	Size          int
+	FeePerByte    float64
+	AncestorFee   int
+	AncestorSize  int
+	AncestorCount int
+	TimeAdded     time.Time
+}
+
+// AncestorFeeRate 是这笔交易连同其未确认祖先的整体手续费率，
+// SelectBlockTemplate 依据它挑选要打包的交易。
+func (e *Entry) AncestorFeeRate() float64 {
+	if e.AncestorSize == 0 {
+		return 0
+	}
+	return float64(e.AncestorFee) / float64(e.AncestorSize)
+}
+
+// Mempool 是进程内未确认交易池。零值不可用，必须通过 New 构造。
+type Mempool struct {
+	entries    map[string]*Entry
+	totalBytes int
+}
+
+// New 构造一个空的内存池。
+func New() *Mempool {
+	return &Mempool{entries: make(map[string]*Entry)}
+}
+
+// Has 判断某笔交易是否已经在池中。
+func (m *Mempool) Has(txID []byte) bool {
+	_, ok := m.entries[hex.EncodeToString(txID)]
+	return ok
+}
+
+// Get 返回池中的交易，若不存在则 ok 为 false。
+func (m *Mempool) Get(txID []byte) (*transaction.Transaction, bool) {
+	e, ok := m.entries[hex.EncodeToString(txID)]
+	if !ok {
+		return nil, false
+	}
+	return e.Tx, true
+}
+
+// Len 返回池中的交易数量。
+func (m *Mempool) Len() int {
+	return len(m.entries)
+}
+
+// Txs 返回池中全部交易，顺序不固定；主要供持久化使用。
+func (m *Mempool) Txs() []*transaction.Transaction {
+	txs := make([]*transaction.Transaction, 0, len(m.entries))
+	for _, e := range m.entries {
+		txs = append(txs, e.Tx)
+	}
+	return txs
+}
+
+// Remove 把一笔交易从池中摘除（例如它已经被打包进区块）。
+func (m *Mempool) Remove(txID []byte) {
+	key := hex.EncodeToString(txID)
+	e, ok := m.entries[key]
+	if !ok {
+		return
+	}
+	m.totalBytes -= e.Size
+	delete(m.entries, key)
+}
+
+// Add 校验并记录一笔交易，按它消耗的输出计算手续费与体积，叠加池内
+// 尚未确认的父交易算出祖先手续费/体积，超出单笔交易的祖先数量/体积上
+// 限时拒绝接纳。接纳后若总体积超过 maxBytes，逐出手续费率最低的交易
+// 腾出空间。
+//
+// 调用方（net.acceptTx）已经在这之前用 missingInput 把引用了未知输出
+// 的交易分流进孤儿交易池，所以这里看到的每个输入都能在 utxoSet 里查到
+// ——祖先体积统计因此只会在极少数"父交易恰好也还在本池里"的情形下真正
+// 生效，多数交易的祖先就是它自己。
+func (m *Mempool) Add(tx *transaction.Transaction, utxoSet *blockchain.UTXOSet) error {
+	key := hex.EncodeToString(tx.ID)
+	if _, exists := m.entries[key]; exists {
+		return nil
+	}
+
+	size := len(tx.Serialize())
+
+	fee, err := txFee(tx, utxoSet)
+	if err != nil {
+		return err
+	}
+	if fee < 0 {
+		return errors.New("mempool: tx outputs exceed inputs")
+	}
+
+	ancestorFee, ancestorSize, ancestorCount := fee, size, 1
+	for _, in := range tx.Vin {
+		parent, ok := m.entries[hex.EncodeToString(in.Txid)]
+		if !ok {
+			continue
+		}
+		ancestorFee += parent.AncestorFee
+		ancestorSize += parent.AncestorSize
+		ancestorCount += parent.AncestorCount
+	}
+
+	if ancestorCount > maxAncestorCount || ancestorSize > maxAncestorSizeBytes {
+		return errors.New("mempool: tx exceeds ancestor count/size limits")
+	}
+
+	m.entries[key] = &Entry{
+		Tx:            tx,
+		Fee:           fee,
+		Size:          size,
+		FeePerByte:    float64(fee) / float64(size),
+		AncestorFee:   ancestorFee,
+		AncestorSize:  ancestorSize,
+		AncestorCount: ancestorCount,
+		TimeAdded:     time.Now(),
+	}
+	m.totalBytes += size
+
+	m.evictUntilUnderCap()
+
+	return nil
+}
+
+// txFee 计算一笔交易愿意支付的手续费：输入引用的未花费输出总值减去
+// 它自己的输出总值。
+func txFee(tx *transaction.Transaction, utxoSet *blockchain.UTXOSet) (int, error) {
+	var inputTotal, outputTotal int
+
+	for _, in := range tx.Vin {
+		out, ok := utxoSet.FindOutput(in.Txid, in.Vout)
+		if !ok {
+			return 0, errors.New("mempool: input references an unavailable output")
+		}
+		inputTotal += out.Value
+	}
+
+	for _, out := range tx.Vout {
+		outputTotal += out.Value
+	}
+
+	return inputTotal - outputTotal, nil
+}
+
+// evictUntilUnderCap 在总体积超过 maxBytes 时，反复逐出当前祖先手续费
+// 率最低的交易，直到回到上限以内。
+func (m *Mempool) evictUntilUnderCap() {
+	for m.totalBytes > maxBytes {
+		var lowestKey string
+		var lowestRate float64
+		first := true
+
+		for key, e := range m.entries {
+			rate := e.AncestorFeeRate()
+			if first || rate < lowestRate {
+				lowestKey, lowestRate, first = key, rate, false
+			}
+		}
+
+		if first {
+			return
+		}
+
+		m.totalBytes -= m.entries[lowestKey].Size
+		delete(m.entries, lowestKey)
+	}
+}
@@ -0,0 +1,44 @@
+package mempool
+
+import (
+	"blockchain_go/blockchain"
+	"blockchain_go/transaction"
+	"bytes"
+	"encoding/gob"
+	"os"
+)
+
+// SaveToDisk 把当前池里的交易序列化写到 path，供节点关闭时保存、重启时
+// 用 Load 取回，避免每次重启都清空内存池。
+func (m *Mempool) SaveToDisk(path string) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m.Txs()); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// Load 从 path 读回一个之前保存的内存池，用 utxoSet 重新核算每笔交易
+// 的手续费与祖先限制；在停机期间被确认或双花掉的交易会在 Add 里被
+// 自然拒绝，直接丢弃即可，不当作致命错误。path 不存在时返回一个空
+// 内存池，对应节点首次启动的情形。
+func Load(path string, utxoSet *blockchain.UTXOSet) (*Mempool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*transaction.Transaction
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&txs); err != nil {
+		return nil, err
+	}
+
+	m := New()
+	for _, tx := range txs {
+		_ = m.Add(tx, utxoSet)
+	}
+	return m, nil
+}
@@ -0,0 +1,83 @@
+package mempool
+
+import (
+	"blockchain_go/transaction"
+	"encoding/hex"
+	"sort"
+)
+
+// SelectBlockTemplate 为矿工挑选要打包进下一个区块的交易：按祖先手续费
+// 率从高到低贪心选取；加入后会超出 maxWeight（以序列化字节数近似区块
+// 权重）的交易包被跳过，继续尝试后面更小的包。取代过去挖矿路径里"遍历
+// 整个 map、验证签名就塞进区块"的无序做法。
+//
+// 选中一笔交易时，它在池内尚未选中的祖先会被一起强制打包（见
+// unselectedAncestorChain），否则高手续费率的子交易可能在手续费率低
+// 的父交易被权重预算挤掉时单独入选，生成一个花费了某个在任何链上都
+// 不存在的UTXO的区块。
+func (m *Mempool) SelectBlockTemplate(maxWeight int) []*transaction.Transaction {
+	entries := make([]*Entry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].AncestorFeeRate() > entries[j].AncestorFeeRate()
+	})
+
+	var selected []*transaction.Transaction
+	included := make(map[string]bool)
+	weight := 0
+
+	for _, e := range entries {
+		if included[hex.EncodeToString(e.Tx.ID)] {
+			continue
+		}
+
+		chain := m.unselectedAncestorChain(e, included)
+		chainWeight := 0
+		for _, a := range chain {
+			chainWeight += a.Size
+		}
+
+		if weight+chainWeight > maxWeight {
+			continue
+		}
+
+		for _, a := range chain {
+			selected = append(selected, a.Tx)
+			included[hex.EncodeToString(a.Tx.ID)] = true
+		}
+		weight += chainWeight
+	}
+
+	return selected
+}
+
+// unselectedAncestorChain 返回 e 连同它在池内尚未选中的祖先，按"祖先在
+// 前、自己在后"的顺序排列，这样一起打包时每笔交易引用的输入都已经在
+// 它前面。
+func (m *Mempool) unselectedAncestorChain(e *Entry, included map[string]bool) []*Entry {
+	var chain []*Entry
+	seen := make(map[string]bool)
+
+	var walk func(entry *Entry)
+	walk = func(entry *Entry) {
+		key := hex.EncodeToString(entry.Tx.ID)
+		if seen[key] || included[key] {
+			return
+		}
+		seen[key] = true
+
+		for _, in := range entry.Tx.Vin {
+			if parent, ok := m.entries[hex.EncodeToString(in.Txid)]; ok {
+				walk(parent)
+			}
+		}
+
+		chain = append(chain, entry)
+	}
+
+	walk(e)
+	return chain
+}
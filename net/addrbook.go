@@ -0,0 +1,152 @@
+package net
+
+import "time"
+
+// staleAfter 是一个地址条目允许多久没消息后被视为失效、进入淘汰候选。
+const staleAfter = 3 * time.Hour
+
+// maxAddrPerMsg 是单条 addr 消息里最多携带的地址数，超过会被截断，
+// 防止恶意节点用超大 addr 消息灌爆对方。
+const maxAddrPerMsg = 1000
+
+// targetOutboundConns 是本节点主动维持的出站连接数目标。
+const targetOutboundConns = 8
+
+// addrEntry 是地址簿里的一条记录。
+type addrEntry struct {
+	addr     string
+	group    string // /16 地址组，用于保证出站连接的网络多样性
+	lastSeen int64
+	tried    bool // 是否已经成功连接过
+}
+
+// addrBook 按 tried / new 两个桶维护已知的对等节点地址，参照比特币的
+// 地址簿设计：tried 桶装确认能连上的地址，new 桶装只是听说过、还没验证
+// 过的地址。
+type addrBook struct {
+	tried map[string]*addrEntry
+	new   map[string]*addrEntry
+}
+
+// maxBookSize 限制每个桶的条目数，防止无限增长。
+const maxBookSize = 4096
+
+var book = &addrBook{
+	tried: make(map[string]*addrEntry),
+	new:   make(map[string]*addrEntry),
+}
+
+// addrGroup 取地址的 /16 前缀作为分组键，outbound 拨号时据此分散连接
+// 的网络来源，避免被单一 /16 的女巫攻击占满连接槽。
+func addrGroup(addr string) string {
+	parts := splitHostPort(addr)
+	octets := splitDots(parts)
+	if len(octets) >= 2 {
+		return octets[0] + "." + octets[1]
+	}
+	return addr
+}
+
+// learnAddr 把一个来自gossip或握手的地址记录进 new 桶（如果它还没被
+// tried 过），并刷新 lastSeen。
+func learnAddr(addr string) {
+	if addr == nodeAddress {
+		return
+	}
+	if _, ok := book.tried[addr]; ok {
+		book.tried[addr].lastSeen = time.Now().Unix()
+		return
+	}
+	if len(book.new) >= maxBookSize {
+		return
+	}
+	book.new[addr] = &addrEntry{addr: addr, group: addrGroup(addr), lastSeen: time.Now().Unix()}
+}
+
+// markTried 在一次成功的出站连接后，把地址从 new 桶移进 tried 桶。
+func markTried(addr string) {
+	if _, ok := book.tried[addr]; !ok && len(book.tried) >= maxBookSize {
+		return
+	}
+	delete(book.new, addr)
+	book.tried[addr] = &addrEntry{addr: addr, group: addrGroup(addr), lastSeen: time.Now().Unix(), tried: true}
+}
+
+// touch 刷新地址的 lastSeen，收到它发来的任意消息（尤其是 pong）时调用。
+func touch(addr string) {
+	if e, ok := book.tried[addr]; ok {
+		e.lastSeen = time.Now().Unix()
+		return
+	}
+	if e, ok := book.new[addr]; ok {
+		e.lastSeen = time.Now().Unix()
+	}
+}
+
+// evictStale 扫描 tried 桶，对超过 staleAfter 没有消息的地址先 ping 一
+// 次确认，仍然静默的则逐出地址簿。调用方负责定期触发（例如一个
+// ticker），pong 收到后 touch 会刷新 lastSeen 从而让条目免于被逐出。
+func evictStale(now int64) {
+	for addr, e := range book.tried {
+		if now-e.lastSeen <= int64(staleAfter.Seconds()) {
+			continue
+		}
+		if !pingedRecently(addr) {
+			sendPing(addr)
+			markPinged(addr)
+			continue
+		}
+		delete(book.tried, addr)
+		delete(pendingPings, addr)
+	}
+}
+
+// pendingPings 记录已经发过 ping、正在等待 pong 回应确认存活的地址。
+var pendingPings = make(map[string]bool)
+
+func pingedRecently(addr string) bool { return pendingPings[addr] }
+func markPinged(addr string)          { pendingPings[addr] = true }
+
+// clearPing 在收到 pong 时调用，表示该地址确认存活。
+func clearPing(addr string) {
+	delete(pendingPings, addr)
+	touch(addr)
+}
+
+// knownAddrs 返回地址簿里全部地址（tried 和 new），供 addr.handleMsg 转
+// 发或 getaddr 应答使用，最多 maxAddrPerMsg 条。
+func knownAddrs() []string {
+	addrs := make([]string, 0, len(book.tried)+len(book.new))
+	for a := range book.tried {
+		addrs = append(addrs, a)
+	}
+	for a := range book.new {
+		addrs = append(addrs, a)
+	}
+	if len(addrs) > maxAddrPerMsg {
+		addrs = addrs[:maxAddrPerMsg]
+	}
+	return addrs
+}
+
+func splitHostPort(addr string) string {
+	for i := len(addr) - 1; i >= 0; i-- {
+		if addr[i] == ':' {
+			return addr[:i]
+		}
+	}
+	return addr
+}
+
+func splitDots(s string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '.' {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, s[start:])
+	return parts
+}
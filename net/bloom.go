@@ -0,0 +1,102 @@
+package net
+
+// BloomFilter 是 BIP37 风格的Bloom过滤器：SPV节点通过 filterload 把它
+// 发给全节点，声明自己关心哪些地址/公钥哈希，全节点据此为它筛选区块
+// 里的交易。
+type BloomFilter struct {
+	bits       []byte
+	nHashFuncs uint32
+	nTweak     uint32
+}
+
+// NewBloomFilter 按位数组大小（字节）、哈希函数个数和随机 tweak 构造一个
+// 空过滤器。nHashFuncs 越多、bits 越大，误判率越低但体积越大。
+func NewBloomFilter(sizeBytes int, nHashFuncs, nTweak uint32) *BloomFilter {
+	return &BloomFilter{
+		bits:       make([]byte, sizeBytes),
+		nHashFuncs: nHashFuncs,
+		nTweak:     nTweak,
+	}
+}
+
+// bip37Seed 是 BIP37 规定的每个哈希函数的种子派生公式。
+func (f *BloomFilter) bip37Seed(hashNum uint32) uint32 {
+	return hashNum*0xFBA4C795 + f.nTweak
+}
+
+// Add 把 data 的 nHashFuncs 个哈希位置都置1。
+func (f *BloomFilter) Add(data []byte) {
+	if len(f.bits) == 0 {
+		return
+	}
+	for i := uint32(0); i < f.nHashFuncs; i++ {
+		idx := murmurHash3(f.bip37Seed(i), data) % uint32(len(f.bits)*8)
+		f.bits[idx/8] |= 1 << (idx % 8)
+	}
+}
+
+// Test 判断 data 是否"可能"在过滤器里（Bloom过滤器允许假阳性、不允许
+// 假阴性）。
+func (f *BloomFilter) Test(data []byte) bool {
+	if len(f.bits) == 0 {
+		return false
+	}
+	for i := uint32(0); i < f.nHashFuncs; i++ {
+		idx := murmurHash3(f.bip37Seed(i), data) % uint32(len(f.bits)*8)
+		if f.bits[idx/8]&(1<<(idx%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// murmurHash3 实现 MurmurHash3 的 32 位版本（x86_32），BIP37 指定用它
+// 作为Bloom过滤器的哈希函数。
+func murmurHash3(seed uint32, data []byte) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	h := seed
+	length := len(data)
+	nblocks := length / 4
+
+	for i := 0; i < nblocks; i++ {
+		k := uint32(data[i*4]) | uint32(data[i*4+1])<<8 | uint32(data[i*4+2])<<16 | uint32(data[i*4+3])<<24
+
+		k *= c1
+		k = (k << 15) | (k >> 17)
+		k *= c2
+
+		h ^= k
+		h = (h << 13) | (h >> 19)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k1 uint32
+	tail := data[nblocks*4:]
+	switch len(tail) {
+	case 3:
+		k1 ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k1 ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k1 ^= uint32(tail[0])
+		k1 *= c1
+		k1 = (k1 << 15) | (k1 >> 17)
+		k1 *= c2
+		h ^= k1
+	}
+
+	h ^= uint32(length)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
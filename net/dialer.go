@@ -0,0 +1,91 @@
+package net
+
+import (
+	"blockchain_go/blockchain"
+	"blockchain_go/log"
+	"math/rand"
+)
+
+// randomPeers 从当前活跃对等节点里随机挑 n 个，排除 exclude（通常是
+// 消息的来源节点，避免把地址回传给它自己）。
+func randomPeers(n int, exclude string) []string {
+	candidates := make([]string, 0, len(activePeers))
+	for addr := range activePeers {
+		if addr != exclude {
+			candidates = append(candidates, addr)
+		}
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// maintainOutboundConns 补齐出站连接到 targetOutboundConns 个，优先从
+// /16 地址组里还没有出站连接的地址中挑选，保证连接来源的网络多样性，
+// 避免被单一网段的女巫节点占满连接槽。调用方（节点主循环）应按固定
+// 周期调用它。
+func maintainOutboundConns(bc *blockchain.Blockchain) {
+	have := len(activePeers) + len(connectingPeers)
+	if have >= targetOutboundConns {
+		return
+	}
+
+	usedGroups := map[string]bool{}
+	for addr := range activePeers {
+		usedGroups[addrGroup(addr)] = true
+	}
+
+	candidates := candidatesByDiversity(usedGroups)
+
+	// 第一轮只拨网络组还没用过的地址，第二轮才放开到任意地址
+	for _, diverseOnly := range []bool{true, false} {
+		for _, addr := range candidates {
+			if have >= targetOutboundConns {
+				return
+			}
+			if _, connecting := connectingPeers[addr]; connecting {
+				continue
+			}
+			if _, active := activePeers[addr]; active {
+				continue
+			}
+			if diverseOnly && usedGroups[addrGroup(addr)] {
+				continue
+			}
+
+			log.Net.Printf("Dialing outbound peer %s\n", addr)
+			connectingPeers[addr] = &connectingPeerStatus{waitVer, 0, nil}
+			sendVersion(addr, bc)
+			usedGroups[addrGroup(addr)] = true
+			have++
+		}
+	}
+}
+
+// candidatesByDiversity 从地址簿里挑选拨号对象：先挑网络组尚未出现在
+// usedGroups 的地址，用完之后再退化为任意已知地址，保证多样性优先但
+// 不会因为地址簿里组数不够而卡死。
+func candidatesByDiversity(usedGroups map[string]bool) []string {
+	var diverse, rest []string
+
+	for addr, e := range book.new {
+		if usedGroups[e.group] {
+			rest = append(rest, addr)
+		} else {
+			diverse = append(diverse, addr)
+		}
+	}
+	for addr, e := range book.tried {
+		if usedGroups[e.group] {
+			rest = append(rest, addr)
+		} else {
+			diverse = append(diverse, addr)
+		}
+	}
+
+	return append(diverse, rest...)
+}
@@ -0,0 +1,13 @@
+package net
+
+import "blockchain_go/log"
+
+// disconnectPeer 把一个发来无效数据的对等节点从连接表中移除，
+// 后续的转发和广播不再选中它。本实现的连接是按地址拨号、一条消息
+// 一条的短连接，没有需要关闭的长连接；它之后发来的消息仍会照常被
+// 分发处理，也可以重新握手回到连接表。
+func disconnectPeer(addr string) {
+	delete(activePeers, addr)
+	delete(connectingPeers, addr)
+	log.Net.Printf("Disconnected peer %s\n", addr)
+}
@@ -0,0 +1,21 @@
+package net
+
+import "blockchain_go/blockchain"
+
+/*
+getaddr消息 "把你知道的节点地址发给我"
+
+发送条件：
+与对等节点完成版本握手之后，用它换取对方地址簿里的地址，逐步摆脱对
+硬编码 knownNodes 的依赖。
+
+消息处理逻辑：
+用 addr 消息回应本节点地址簿里已知的地址（最多 maxAddrPerMsg 条）。
+*/
+type getaddr struct {
+	AddrFrom string
+}
+
+func (payload *getaddr) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
+	sendAddr(fromAddr, knownAddrs())
+}
@@ -0,0 +1,9 @@
+package net
+
+// getheaders消息 "把你知道的区块头发给我"
+//
+// 发送条件：
+// SPV 节点或正在做初始区块下载的全节点，只想先同步头部链。
+type getheaders struct {
+	AddrFrom string
+}
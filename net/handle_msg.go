@@ -3,16 +3,15 @@ package net
 import (
 	"blockchain_go/blockchain"
 	"blockchain_go/log"
+	"blockchain_go/mempool"
 	"blockchain_go/miner"
 	"blockchain_go/transaction"
-	"bytes"
-	"encoding/hex"
 	"time"
 )
 
-// 正在下载中的区块hash列表
-var blocksInTransit = [][]byte{}
-var mempool = make(map[string]transaction.Transaction)
+// txPool 取代过去裸的 map[string]Transaction：按手续费率排序、限制总
+// 体积与单笔交易的祖先体积，参见 mempool 包。
+var txPool = mempool.New()
 
 /*
 From https://en.bitcoin.it/wiki/Version_Handshake
@@ -87,6 +86,7 @@ func (payload *verack) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
 
 	delete(connectingPeers, fromAddr)
 	activePeers[fromAddr] = time.Now().Unix()
+	markTried(fromAddr)
 
 	versionMsg := status.versionMsg
 	myBestHeight := bc.GetBestHeight()
@@ -95,6 +95,9 @@ func (payload *verack) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
 	if myBestHeight < foreignerBestHeight {
 		sendGetBlocks(fromAddr)
 	}
+
+	// 握手完成后请求对方已知的地址，充实本地地址簿
+	sendGetAddr(fromAddr)
 }
 
 /*
@@ -131,24 +134,20 @@ func (payload *inv) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
 	log.Net.Printf("Recevied inventory with %d %s\n", len(payload.Items), payload.Type)
 
 	if payload.Type == "block" {
-		blocksInTransit = payload.Items
-
-		blockHash := payload.Items[0]
-		sendGetData(fromAddr, "block", blockHash)
-
-		newInTransit := [][]byte{}
-		for _, b := range blocksInTransit {
-			if bytes.Compare(b, blockHash) != 0 {
-				newInTransit = append(newInTransit, b)
-			}
+		lastHash := payload.Items[len(payload.Items)-1]
+		if _, err := bc.GetBlock(lastHash); err != nil {
+			// 我们落后的区块不止一个，先做头部优先同步：问对方要
+			// 完整的头部链，headers.handleMsg 收到后会按高度把区块体
+			// 的下载任务并行分给多个对等节点（见 ibd.go），不再像过去
+			// 那样把整批哈希塞进一个全局队列逐个请求。
+			sendGetHeaders(fromAddr)
 		}
-		blocksInTransit = newInTransit
 	}
 
 	if payload.Type == "tx" {
 		txID := payload.Items[0]
 
-		if mempool[hex.EncodeToString(txID)].ID == nil {
+		if !txPool.Has(txID) {
 			sendGetData(fromAddr, "tx", txID)
 		}
 	}
@@ -172,15 +171,29 @@ func (payload *getdata) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
 			return
 		}
 
-		sendBlock(fromAddr, &block)
+		if _, isSPVPeer := peerFilters[fromAddr]; isSPVPeer {
+			sendMerkleBlock(fromAddr, &block)
+		} else {
+			sendBlock(fromAddr, &block)
+		}
+	}
+
+	if payload.Type == "merkleblock" {
+		block, err := bc.GetBlock([]byte(payload.ID))
+		if err != nil {
+			return
+		}
+
+		sendMerkleBlock(fromAddr, &block)
 	}
 
 	if payload.Type == "tx" {
-		txID := hex.EncodeToString(payload.ID)
-		tx := mempool[txID]
+		tx, ok := txPool.Get(payload.ID)
+		if !ok {
+			return
+		}
 
-		SendTx(fromAddr, &tx)
-		// delete(mempool, txID)
+		SendTx(fromAddr, tx)
 	}
 }
 
@@ -191,34 +204,84 @@ block消息 "给你区块数据"
 用于对getdata消息进行相应，返回区块数据
 
 消息处理逻辑：
-验证区块，并将其放到本地区块链里
-
-TODO：并非无条件信任，我们应该在将每个块加入到区块链之前对它们进行验证。
-TODO: 并非运行 UTXOSet.Reindex()， 而是应该使用 UTXOSet.Update(block)，因为如果区块链很大，它将需要很多时间来对整个 UTXO 集重新索引。
+对区块做完整校验（PoW、梅克尔根、时间戳、体积、coinbase、交易签名与UTXO可用性），
+未通过校验的区块直接丢弃并断开发送方；
+若区块的父区块未知，先放进孤块池，再向发送方请求缺失的区块，等父区块到达后重放；
+若区块延伸的是非当前最长链的侧链，且侧链因此变得比当前最长链还长，则触发重组。
 */
 func (payload *block) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
 	blockData := payload.Block
-	block := blockchain.DeserializeBlock(blockData)
+	newBlock := blockchain.DeserializeBlock(blockData)
 
-	_, err := bc.GetBlock(block.Hash)
+	_, err := bc.GetBlock(newBlock.Hash)
 	if err == nil {
 		return
 	}
 
-	log.Net.Println("Recevied a new block!")
-	bc.AddBlock(block)
+	if err := acceptBlock(bc, newBlock, fromAddr); err != nil {
+		log.Net.Printf("Rejected block %x from %s: %v\n", newBlock.Hash, fromAddr, err)
+		disconnectPeer(fromAddr)
+		return
+	}
 
-	log.Net.Printf("Added block %x\n", block.Hash)
+	clearInFlight(newBlock.Hash)
 
-	if len(blocksInTransit) > 0 {
-		blockHash := blocksInTransit[0]
-		sendGetData(fromAddr, "block", blockHash)
+	if hc := getHeaderChain(bc); hc != nil {
+		scheduleBodyFetch(bc, hc)
+	}
+}
 
-		blocksInTransit = blocksInTransit[1:]
-	} else {
-		UTXOSet := blockchain.UTXOSet{bc}
-		UTXOSet.Reindex()
+// acceptBlock 校验并接入一个新收到的区块，同时处理孤块缓冲与链重组。
+func acceptBlock(bc *blockchain.Blockchain, newBlock *blockchain.Block, fromAddr string) error {
+	if _, err := bc.GetBlock(newBlock.PrevBlockHash); err != nil {
+		// 父区块未知：缓存为孤块，向发送方请求缺失的那一段
+		log.Net.Printf("Block %x is an orphan, requesting missing parent %x\n", newBlock.Hash, newBlock.PrevBlockHash)
+		addOrphanBlock(newBlock)
+		sendGetBlocks(fromAddr)
+		return nil
+	}
+
+	if err := blockchain.ValidateBlock(bc, newBlock); err != nil {
+		return err
+	}
+
+	if err := connectBlock(bc, newBlock); err != nil {
+		return err
+	}
+
+	// 这些交易已经被别的节点挖进区块，不能再留在池里等着被重新选进
+	// 我们自己的下一个区块模板——那会造出一个花费已花掉的输出的块。
+	for _, confirmedTx := range newBlock.Transactions {
+		txPool.Remove(confirmedTx.ID)
+	}
+
+	log.Net.Printf("Added block %x\n", newBlock.Hash)
+
+	// 父区块已落地，看看是否有依赖它的孤块可以接着重放
+	for _, orphan := range popOrphanBlocks(newBlock.Hash) {
+		if err := acceptBlock(bc, orphan, fromAddr); err != nil {
+			log.Net.Printf("Rejected previously orphaned block %x: %v\n", orphan.Hash, err)
+		}
+	}
+
+	return nil
+}
+
+// connectBlock 把已经通过校验的区块接入链上。它总是先用 StoreBlock 把
+// 区块本体落盘（不管它延伸的是主链还是侧链），这样后续区块才有父区块
+// 可查。只有当它的高度超过当前最长链时才会触发 Reorganize 把链尖切过
+// 去；否则它只是静静地躺在侧链里，等将来被反超或者被进一步延伸。
+func connectBlock(bc *blockchain.Blockchain, newBlock *blockchain.Block) error {
+	if err := bc.StoreBlock(newBlock); err != nil {
+		return err
+	}
+
+	if newBlock.Height <= bc.GetBestHeight() {
+		return nil
 	}
+
+	utxoSet := blockchain.UTXOSet{bc}
+	return blockchain.Reorganize(bc, &utxoSet, newBlock.Hash)
 }
 
 /*
@@ -228,79 +291,108 @@ tx消息 "给你交易数据"
 用于对getdata消息进行相应，返回交易数据
 
 消息处理逻辑：
-1. 对交易进行验证，将新交易放到内存池中
-2. 向其他节点relay inv消息
+1. 对交易签名及其引用的UTXO做验证，引用了未知输出的交易先放进孤儿交易池
+2. 验证通过后放到内存池中，并触发依赖它的孤儿交易重放
+3. 向其他节点relay inv消息
 https://en.bitcoin.it/wiki/Protocol_rules#.22tx.22_messages
-
-TODO: 在将交易放到内存池之前，对其进行验证
-TODO: orphan transactions 管理
 */
 func (payload *tx) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
 	tx := payload.Transaction
 	if tx.IsCoinbase() {
-		// TODO 异常
+		disconnectPeer(fromAddr)
 		return
 	}
 
-	if len(tx.Vout) == 0 || len(tx.Vout) == 0 {
+	if len(tx.Vout) == 0 {
 		return
 	}
 
-	_, exist := mempool[hex.EncodeToString(tx.ID)]
-	if exist {
+	if txPool.Has(tx.ID) {
 		return
 	}
 
-	mempool[hex.EncodeToString(tx.ID)] = tx
+	if err := acceptTx(bc, &tx, fromAddr); err != nil {
+		log.Net.Printf("Rejected tx %x from %s: %v\n", tx.ID, fromAddr, err)
+		disconnectPeer(fromAddr)
+		return
+	}
+
+	// 不再区分"中心节点"，任何节点收到新交易都向若干随机对等节点转发，
+	// 让交易像地址一样靠gossip扩散到全网
+	for _, node := range randomPeers(txRelayFanout, fromAddr) {
+		sendInv(node, "tx", [][]byte{tx.ID})
+	}
+
+	// 矿工节使用交易挖矿
+	if txPool.Len() >= 2 && len(miningAddress) > 0 {
+	MineTransactions:
+		txs := txPool.SelectBlockTemplate(blockchain.MaxBlockSize)
 
-	if nodeAddress == knownNodes[0] {
-		// 中心节点向其他节点广播交易消息
-		for _, node := range knownNodes {
-			if node != fromAddr {
-				sendInv(node, "tx", [][]byte{tx.ID})
-			}
+		if len(txs) == 0 {
+			log.Net.Println("All transactions are invalid! Waiting for new ones...")
+			return
 		}
-	} else {
-		// 矿工节使用交易挖矿
-		if len(mempool) >= 2 && len(miningAddress) > 0 {
-		MineTransactions:
-			var txs []*transaction.Transaction
-
-			for id := range mempool {
-				tx := mempool[id]
-				if bc.VerifyTransactionSig(&tx) {
-					txs = append(txs, &tx)
-				}
-			}
-
-			if len(txs) == 0 {
-				log.Net.Println("All transactions are invalid! Waiting for new ones...")
-				return
-			}
-
-			cbTx := transaction.NewCoinbaseTX(miningAddress, "")
-			txs = append(txs, cbTx)
-
-			newBlock := miner.MineBlock(bc, txs)
-			UTXOSet := blockchain.UTXOSet{bc}
-			UTXOSet.Reindex()
-
-			log.Net.Println("New block is mined!")
-
-			for _, tx := range txs {
-				txID := hex.EncodeToString(tx.ID)
-				delete(mempool, txID)
-			}
-
-			for _, node := range knownNodes {
-				sendInv(node, "block", [][]byte{newBlock.Hash})
-			}
-
-			if len(mempool) > 0 {
-				goto MineTransactions
-			}
+
+		cbTx := transaction.NewCoinbaseTX(miningAddress, "")
+		txs = append([]*transaction.Transaction{cbTx}, txs...)
+
+		newBlock := miner.MineBlock(bc, txs)
+		UTXOSet := blockchain.UTXOSet{bc}
+		if err := UTXOSet.Update(newBlock); err != nil {
+			log.Net.Printf("Failed to update UTXO set after mining: %v\n", err)
+		}
+
+		log.Net.Println("New block is mined!")
+
+		for _, tx := range txs {
+			txPool.Remove(tx.ID)
+		}
+
+		// 和上面的交易转发一样，新挖出的区块要广播给gossip发现的整个
+		// 活跃对等节点集合，而不是只发给引导用的种子节点——否则只靠
+		// addr/getaddr 加入、从未直接连上种子节点的对等节点永远不会
+		// 及时听说这个新区块。
+		for node := range activePeers {
+			sendInv(node, "block", [][]byte{newBlock.Hash})
+		}
+
+		if txPool.Len() > 0 {
+			goto MineTransactions
+		}
+	}
+}
+
+// txRelayFanout 是新交易被接受后随机转发给多少个对等节点。
+const txRelayFanout = 2
+
+// acceptTx 验证一笔交易的签名与输入可用性后放入内存池；若某个输入引用
+// 的输出当前找不到，认为父交易尚未到达，把交易缓存进孤儿交易池并返回
+// nil（不算拒绝，只是还不能确认）。交易被接受后会顺带重放所有在等它
+// 的孤儿交易。
+func acceptTx(bc *blockchain.Blockchain, txn *transaction.Transaction, fromAddr string) error {
+	utxoSet := blockchain.UTXOSet{bc}
+
+	if missing := missingInput(&utxoSet, txn); missing != nil {
+		log.Net.Printf("Tx %x references unknown output %x, parking as orphan\n", txn.ID, missing)
+		addOrphanTx(missing, txn)
+		return nil
+	}
+
+	if err := blockchain.ValidateTransaction(bc, &utxoSet, txn); err != nil {
+		return err
+	}
+
+	if err := txPool.Add(txn, &utxoSet); err != nil {
+		return err
+	}
+
+	for _, orphan := range popOrphanTxs(txn.ID) {
+		if err := acceptTx(bc, orphan, fromAddr); err != nil {
+			log.Net.Printf("Rejected previously orphaned tx %x: %v\n", orphan.ID, err)
 		}
 	}
+
+	return nil
 }
 
 /*
@@ -312,6 +404,49 @@ func (payload *ping) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
 	sendPong(fromAddr)
 }
 
+/*
+addr消息 "这些是我知道的节点地址"
+
+发送条件：
+响应 getaddr 请求，或者把刚学到的新鲜地址转发给另外两个随机对等节点。
+
+消息处理逻辑：
+把最多 maxAddrPerMsg 条地址记入本地地址簿的 new 桶，并把其中"新鲜"的
+（地址簿里原本没有的）转发给两个随机挑选的已连接节点，帮助地址在网络
+里扩散。出站拨号器会从地址簿里挑选地址去补满 targetOutboundConns。
+*/
 func (payload *addr) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
+	addrs := payload.AddrList
+	if len(addrs) > maxAddrPerMsg {
+		addrs = addrs[:maxAddrPerMsg]
+	}
 
+	var fresh []string
+	for _, a := range addrs {
+		if !knownAddr(a) {
+			fresh = append(fresh, a)
+		}
+		learnAddr(a)
+	}
+
+	relayAddrs(fresh, fromAddr)
+}
+
+// knownAddr 判断地址是否已经在本地地址簿中。
+func knownAddr(a string) bool {
+	_, inTried := book.tried[a]
+	_, inNew := book.new[a]
+	return inTried || inNew
+}
+
+// relayAddrs 把新鲜地址转发给两个随机挑选的、非来源节点的活跃对等节点。
+func relayAddrs(addrs []string, exclude string) {
+	if len(addrs) == 0 {
+		return
+	}
+
+	targets := randomPeers(2, exclude)
+	for _, peer := range targets {
+		sendAddr(peer, addrs)
+	}
 }
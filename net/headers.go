@@ -0,0 +1,90 @@
+package net
+
+import (
+	"blockchain_go/blockchain"
+	"blockchain_go/log"
+)
+
+// headerChain 在headers-first同步进行期间保存当前已知最优的纯头部链，
+// 首次用到时才用本地创世区块惰性地种下初值。
+var headerChain *blockchain.HeaderChain
+
+func getHeaderChain(bc *blockchain.Blockchain) *blockchain.HeaderChain {
+	if headerChain == nil {
+		hashes := bc.GetBlockHashes()
+		if len(hashes) == 0 {
+			return nil
+		}
+		// GetBlockHashes 按"从链尖到创世区块"排列，最后一个就是创世区块
+		genesis, err := bc.GetBlock(hashes[len(hashes)-1])
+		if err != nil {
+			log.Net.Printf("Cannot seed header chain: %v\n", err)
+			return nil
+		}
+		headerChain = blockchain.NewHeaderChain(genesis.Header())
+	}
+	return headerChain
+}
+
+/*
+getheaders消息 "把你知道的区块头发给我"
+
+消息处理逻辑：
+回一条 headers 消息，带上本节点当前最长链上的全部区块头（只有头部，
+不含交易），按从创世区块到链尖的顺序排列，供对方节点做头部优先同步。
+*/
+func (payload *getheaders) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
+	hashes := bc.GetBlockHashes()
+
+	headers := make([]blockchain.BlockHeader, 0, len(hashes))
+	// hashes 是"链尖到创世区块"的顺序，倒着取，让每个头部的父头部先到
+	for i := len(hashes) - 1; i >= 0; i-- {
+		block, err := bc.GetBlock(hashes[i])
+		if err != nil {
+			continue
+		}
+		headers = append(headers, block.Header())
+	}
+
+	sendHeaders(fromAddr, headers)
+}
+
+/*
+headers消息 "这是你要的区块头"
+
+发送条件：
+响应 getheaders，或者在挖出/收到新区块时顺带广播新区块头。
+
+消息处理逻辑：
+对每个区块头校验其工作量证明，并确认它确实接在一个已知头部后面；
+全部头部验证通过、追上了对方最长链之后，进入"按高度并行拉取区块体"
+阶段（见 ibd.go 的 scheduleBodyFetch）。
+*/
+type headers struct {
+	AddrFrom string
+	Headers  []blockchain.BlockHeader
+}
+
+func (payload *headers) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
+	hc := getHeaderChain(bc)
+	if hc == nil {
+		return
+	}
+
+	accepted := 0
+	for _, h := range payload.Headers {
+		if hc.Has(h.Hash) {
+			continue
+		}
+		if _, err := hc.Add(h); err != nil {
+			log.Net.Printf("Rejecting header chain from %s: %v\n", fromAddr, err)
+			disconnectPeer(fromAddr)
+			return
+		}
+		accepted++
+	}
+
+	log.Net.Printf("Accepted %d new header(s) from %s, tip now %x\n", accepted, fromAddr, hc.Tip())
+
+	scheduleBodyFetch(bc, hc)
+}
@@ -0,0 +1,138 @@
+package net
+
+import (
+	"blockchain_go/blockchain"
+	"blockchain_go/log"
+	"time"
+)
+
+// bodyWindow 是headers-first IBD期间一次向单个对等节点请求的区块体数量，
+// 下载任务因此能在多个对等节点间并行，而不是谁先发来inv就一个一个跟谁
+// 要。
+const bodyWindow = 16
+
+// bodyRequestTimeout 限定对等节点回应一个区块体 getdata 请求的时间，
+// 超时则认为这个请求卡住了，把它释放给别的节点重新领取。
+const bodyRequestTimeout = 30 * time.Second
+
+// inFlightRequest 是分配给某个对等节点的一个区块体请求，记录下来是为了
+// 让卡住的节点不会拖住整个同步进度。
+type inFlightRequest struct {
+	hash        []byte
+	requestedAt time.Time
+}
+
+// inFlightByPeer 取代过去那个全局的 blocksInTransit 切片：每个对等节点
+// 有自己独立的在途窗口，这样N个节点合计最多可以同时下载 bodyWindow*N
+// 个区块体。
+var inFlightByPeer = make(map[string]map[string]*inFlightRequest)
+
+// pendingHeights 是头部链上还没请求过区块体（或请求超时后被释放）的
+// 高度，按高度顺序排队，这样区块体一到就能尽量按顺序接上本地链。
+var pendingHeights []int
+
+// scheduleBodyFetch 检查头部链，把本地链尖之后、还没排队也没在途的高度
+// 入队，再把 bodyWindow 个一组的高度分给已知的对等节点去请求。
+func scheduleBodyFetch(bc *blockchain.Blockchain, hc *blockchain.HeaderChain) {
+	enqueueMissingHeights(bc, hc)
+	reapStalledRequests()
+	assignWindows(hc)
+}
+
+func enqueueMissingHeights(bc *blockchain.Blockchain, hc *blockchain.HeaderChain) {
+	queued := map[int]bool{}
+	for _, h := range pendingHeights {
+		queued[h] = true
+	}
+	for _, reqs := range inFlightByPeer {
+		for _, r := range reqs {
+			if h, ok := hc.Header(r.hash); ok {
+				queued[h.Height] = true
+			}
+		}
+	}
+
+	best := bc.GetBestHeight()
+	tip, ok := hc.Header(hc.Tip())
+	if !ok {
+		return
+	}
+
+	for height := best + 1; height <= tip.Height; height++ {
+		if !queued[height] {
+			pendingHeights = append(pendingHeights, height)
+		}
+	}
+}
+
+// reapStalledRequests 释放超过 bodyRequestTimeout 仍未应答的请求槽位，
+// 好让别的对等节点接手那个高度。
+func reapStalledRequests() {
+	now := time.Now()
+	for peer, reqs := range inFlightByPeer {
+		for key, r := range reqs {
+			if now.Sub(r.requestedAt) <= bodyRequestTimeout {
+				continue
+			}
+			log.Net.Printf("Body request to %s timed out, reassigning\n", peer)
+			if h, ok := headerChain.Header(r.hash); ok {
+				pendingHeights = append(pendingHeights, h.Height)
+			}
+			delete(reqs, key)
+		}
+	}
+}
+
+// assignWindows 把排队中的高度分给每个已知的、在途窗口还没满的对等
+// 节点，每个节点最多分到 bodyWindow 个。
+func assignWindows(hc *blockchain.HeaderChain) {
+	for peer := range activePeers {
+		if len(pendingHeights) == 0 {
+			return
+		}
+
+		reqs, ok := inFlightByPeer[peer]
+		if !ok {
+			reqs = make(map[string]*inFlightRequest)
+			inFlightByPeer[peer] = reqs
+		}
+
+		for len(reqs) < bodyWindow && len(pendingHeights) > 0 {
+			height := pendingHeights[0]
+			pendingHeights = pendingHeights[1:]
+
+			hash := hashAtHeight(hc, height)
+			if hash == nil {
+				continue
+			}
+
+			reqs[string(hash)] = &inFlightRequest{hash: hash, requestedAt: time.Now()}
+			sendGetData(peer, "block", hash)
+		}
+	}
+}
+
+// hashAtHeight 从头部链的最优分支尖端往回走，找到给定高度对应的哈希。
+// 头部链只存头部、体积很小，每次查询都线性回溯是可以接受的。
+func hashAtHeight(hc *blockchain.HeaderChain, height int) []byte {
+	cursor := hc.Tip()
+	for len(cursor) > 0 {
+		h, ok := hc.Header(cursor)
+		if !ok {
+			return nil
+		}
+		if h.Height == height {
+			return h.Hash
+		}
+		cursor = h.PrevBlockHash
+	}
+	return nil
+}
+
+// clearInFlight 在区块体实际到达后（由 block.handleMsg 调用）把对应的
+// 请求标记为已完成，腾出槽位供下一轮窗口分配使用。
+func clearInFlight(hash []byte) {
+	for _, reqs := range inFlightByPeer {
+		delete(reqs, string(hash))
+	}
+}
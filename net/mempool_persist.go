@@ -0,0 +1,35 @@
+package net
+
+import (
+	"blockchain_go/blockchain"
+	"blockchain_go/log"
+	"blockchain_go/mempool"
+)
+
+// mempoolPath 是内存池持久化到磁盘的默认位置，与 blockchain 包按
+// nodeID 区分数据库文件的惯例保持一致。
+func mempoolPath(nodeID string) string {
+	return "mempool_" + nodeID + ".dat"
+}
+
+// LoadMempool 在节点启动时从磁盘取回上次关闭前保存的内存池，交易逐一
+// 用当前 UTXO 集合重新核算手续费与祖先限制；在停机期间被确认或双花掉
+// 的交易会被自然丢弃。应当在节点开始处理网络消息之前调用一次。
+func LoadMempool(nodeID string, bc *blockchain.Blockchain) {
+	utxoSet := blockchain.UTXOSet{bc}
+	pool, err := mempool.Load(mempoolPath(nodeID), &utxoSet)
+	if err != nil {
+		log.Net.Printf("Failed to load mempool from disk, starting empty: %v\n", err)
+		return
+	}
+	txPool = pool
+	log.Net.Printf("Loaded %d pending tx(s) from disk\n", txPool.Len())
+}
+
+// SaveMempool 把当前内存池写回磁盘，应当在节点关闭前调用，好让下次
+// 启动时 LoadMempool 能把未确认交易找回来。
+func SaveMempool(nodeID string) {
+	if err := txPool.SaveToDisk(mempoolPath(nodeID)); err != nil {
+		log.Net.Printf("Failed to save mempool to disk: %v\n", err)
+	}
+}
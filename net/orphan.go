@@ -0,0 +1,85 @@
+package net
+
+import (
+	"blockchain_go/blockchain"
+	"blockchain_go/transaction"
+	"encoding/hex"
+)
+
+// orphanBlocks 缓存那些 PrevBlockHash 在本地链上找不到的区块，按缺失的
+// 父区块哈希索引，父区块到达后即可从这里取出重放。
+var orphanBlocks = make(map[string][]*blockchain.Block)
+
+// orphanBlockCount 是 orphanBlocks 里缓存的区块总数（所有键下的切片
+// 长度之和）。map 的键数只是不同的缺失父哈希数，一个恶意对等节点可以
+// 把无限多个区块都指向同一个缺失父哈希，全部挤进同一个键下的切片，
+// 那样光比较 len(orphanBlocks) 挡不住它，必须单独数总条目。
+var orphanBlockCount int
+
+// orphanTxs 缓存那些引用了未知输出（父交易还没到达）的交易，按缺失的
+// 输入 txid 索引。
+var orphanTxs = make(map[string][]*transaction.Transaction)
+
+// orphanTxCount 是 orphanTxs 里缓存的交易总数，道理与 orphanBlockCount
+// 相同：键数只是不同的缺失父交易数，总条目数才是需要限制的量。
+var orphanTxCount int
+
+// addOrphanBlock 把一个父区块未知的区块放入孤块池，等待父区块到达。
+func addOrphanBlock(block *blockchain.Block) {
+	if orphanBlockCount >= maxOrphanBlocks {
+		return
+	}
+	key := hex.EncodeToString(block.PrevBlockHash)
+	orphanBlocks[key] = append(orphanBlocks[key], block)
+	orphanBlockCount++
+}
+
+// popOrphanBlocks 取出并移除所有以 parentHash 为父区块的孤块，
+// 调用方应当把它们逐一重放进 acceptBlock（它们自己落地后还可能
+// 解开更深层的孤块，因此重放需递归/循环进行）。
+func popOrphanBlocks(parentHash []byte) []*blockchain.Block {
+	key := hex.EncodeToString(parentHash)
+	blocks := orphanBlocks[key]
+	delete(orphanBlocks, key)
+	orphanBlockCount -= len(blocks)
+	return blocks
+}
+
+// maxOrphanBlocks 限制孤块池缓存的区块总数，避免恶意节点用 PrevBlockHash
+// 指向不存在区块的区块把这个map灌爆内存。
+const maxOrphanBlocks = 100
+
+// addOrphanTx 把一笔输入指向未知 UTXO 的交易放入孤儿交易池，
+// missingTxID 为缺失的那笔父交易 ID。
+func addOrphanTx(missingTxID []byte, tx *transaction.Transaction) {
+	if orphanTxCount >= maxOrphanTxs {
+		return
+	}
+	key := hex.EncodeToString(missingTxID)
+	orphanTxs[key] = append(orphanTxs[key], tx)
+	orphanTxCount++
+}
+
+// popOrphanTxs 取出并移除所有依赖 parentTxID 的孤儿交易。
+func popOrphanTxs(parentTxID []byte) []*transaction.Transaction {
+	key := hex.EncodeToString(parentTxID)
+	txs := orphanTxs[key]
+	delete(orphanTxs, key)
+	orphanTxCount -= len(txs)
+	return txs
+}
+
+// maxOrphanTxs 限制孤儿交易池缓存的交易总数，避免恶意节点用无法确认的
+// 交易灌爆内存。
+const maxOrphanTxs = 100
+
+// missingInput 在 utxoSet 里找不到可用输出时返回缺失的那个输入 txid；
+// 若所有输入都可花费则返回 nil。
+func missingInput(utxoSet *blockchain.UTXOSet, tx *transaction.Transaction) []byte {
+	for _, in := range tx.Vin {
+		if !utxoSet.IsSpendable(in.Txid, in.Vout) {
+			return in.Txid
+		}
+	}
+	return nil
+}
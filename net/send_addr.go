@@ -0,0 +1,17 @@
+package net
+
+// sendGetAddr 请求 addr 把它地址簿里已知的节点地址发回来。
+func sendGetAddr(addr string) {
+	payload := gobEncode(getaddr{nodeAddress})
+	sendData(addr, encodeMessage("getaddr", payload))
+}
+
+// sendAddr 把一组地址发给 to，对方收到后会记入自己的地址簿并继续
+// 向外转发其中新鲜的部分。
+func sendAddr(to string, addrs []string) {
+	if len(addrs) == 0 {
+		return
+	}
+	payload := gobEncode(addr{nodeAddress, addrs})
+	sendData(to, encodeMessage("addr", payload))
+}
@@ -0,0 +1,32 @@
+package net
+
+import "blockchain_go/blockchain"
+
+// sendFilterLoad 把本节点（以SPV角色运行时）关心的Bloom过滤器发给
+// addr，请求它之后按过滤器匹配结果回应 merkleblock 而不是完整区块。
+func sendFilterLoad(addr string, filter *BloomFilter) {
+	payload := gobEncode(filterload{nodeAddress, filter.bits, filter.nHashFuncs, filter.nTweak})
+	sendData(addr, encodeMessage("filterload", payload))
+}
+
+// sendMerkleBlock 用 block 和 addr 已加载的过滤器组装一个 merkleblock
+// 消息并发送，取代 sendBlock 响应 getdata 的 "merkleblock" 类型请求。
+func sendMerkleBlock(addr string, block *blockchain.Block) {
+	mb := buildMerkleBlock(block, peerFilters[addr])
+	payload := gobEncode(*mb)
+	sendData(addr, encodeMessage("merkleblock", payload))
+}
+
+// sendGetHeaders 请求 addr 发来它已知的区块头链，SPV节点同步时只拉
+// 取头部、不拉取完整区块体。
+func sendGetHeaders(addr string) {
+	payload := gobEncode(getheaders{nodeAddress})
+	sendData(addr, encodeMessage("getheaders", payload))
+}
+
+// sendHeaders 回应 getheaders，把本节点最长链上的区块头（不含交易）
+// 发给 addr，供对方做头部优先同步。
+func sendHeaders(addr string, hdrs []blockchain.BlockHeader) {
+	payload := gobEncode(headers{nodeAddress, hdrs})
+	sendData(addr, encodeMessage("headers", payload))
+}
@@ -0,0 +1,348 @@
+package net
+
+import (
+	"blockchain_go/blockchain"
+	"blockchain_go/log"
+	"blockchain_go/transaction"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	stdnet "net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// protocol 是节点间通信使用的传输层协议。每次发送都会按 disconnectPeer
+// 注释里说的那样拨一条新的短连接，写完一条消息就关闭，所以一次 Accept
+// 到的连接也只携带一条消息，handleConnection 读完、分发完就收尾。
+const protocol = "tcp"
+
+// nodeVersion 是本实现的协议版本号，塞进 version 消息里。
+const nodeVersion = 1
+
+// maxConnectPeer 限制同时处于握手中的对等节点数量，避免握手阶段本身
+// 被大量半开连接占满。
+const maxConnectPeer = 64
+
+// nodeAddress 是本节点自己的监听地址，握手、地址簿、Bloom过滤器tweak等
+// 多处都会用到。
+var nodeAddress string
+
+// knownNodes 是启动时引导用的种子节点；握手之后地址簿和gossip很快会
+// 接管地址发现，这里只负责让节点认识网络里的第一个对等节点。
+var knownNodes = []string{"localhost:3000"}
+
+// miningAddress 非空时，本节点在内存池攒够交易后会尝试挖矿，把奖励付
+// 给这个地址。
+var miningAddress string
+
+const (
+	waitVer = iota
+	waitVerAck
+)
+
+// connectingPeerStatus 记录一次正在进行中的version/verack握手。
+type connectingPeerStatus struct {
+	status     int
+	timestamp  int64
+	versionMsg *version
+}
+
+// connectingPeers 是尚未完成握手的对等节点；activePeers 是已完成握手、
+// 可以正常收发业务消息的对等节点，值是最近一次活跃的Unix时间戳。
+var connectingPeers = make(map[string]*connectingPeerStatus)
+var activePeers = make(map[string]int64)
+
+type version struct {
+	Version    int
+	BestHeight int
+	AddrFrom   string
+}
+
+type verack struct {
+	AddrFrom string
+}
+
+type getblocks struct {
+	AddrFrom string
+}
+
+type inv struct {
+	AddrFrom string
+	Type     string
+	Items    [][]byte
+}
+
+type getdata struct {
+	AddrFrom string
+	Type     string
+	ID       []byte
+}
+
+type block struct {
+	AddrFrom string
+	Block    []byte
+}
+
+type tx struct {
+	AddrFrom    string
+	Transaction transaction.Transaction
+}
+
+type ping struct {
+	AddrFrom string
+}
+
+type pong struct {
+	AddrFrom string
+}
+
+type addr struct {
+	AddrFrom string
+	AddrList []string
+}
+
+// gobEncode 把任意消息payload编码成gob字节流，供 encodeMessage 包进
+// 带magic/checksum的帧里。
+func gobEncode(data interface{}) []byte {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		log.Net.Panic(err)
+	}
+	return buf.Bytes()
+}
+
+// sendData 拨一条到 addr 的短连接，把已经帧封装好的字节流写过去就关闭。
+// 对方不可达时直接清理本地认为它还在的握手/连接状态，不重试。
+func sendData(addr string, data []byte) {
+	conn, err := stdnet.Dial(protocol, addr)
+	if err != nil {
+		log.Net.Printf("%s is not available\n", addr)
+		delete(activePeers, addr)
+		delete(connectingPeers, addr)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(data); err != nil {
+		log.Net.Println(err)
+	}
+}
+
+func sendVersion(addr string, bc *blockchain.Blockchain) {
+	payload := gobEncode(version{nodeVersion, bc.GetBestHeight(), nodeAddress})
+	sendData(addr, encodeMessage("version", payload))
+}
+
+func sendVerack(addr string) {
+	payload := gobEncode(verack{nodeAddress})
+	sendData(addr, encodeMessage("verack", payload))
+}
+
+func sendGetBlocks(addr string) {
+	payload := gobEncode(getblocks{nodeAddress})
+	sendData(addr, encodeMessage("getblocks", payload))
+}
+
+func sendInv(addr, kind string, items [][]byte) {
+	payload := gobEncode(inv{nodeAddress, kind, items})
+	sendData(addr, encodeMessage("inv", payload))
+}
+
+func sendGetData(addr, kind string, id []byte) {
+	payload := gobEncode(getdata{nodeAddress, kind, id})
+	sendData(addr, encodeMessage("getdata", payload))
+}
+
+func sendBlock(addr string, b *blockchain.Block) {
+	payload := gobEncode(block{nodeAddress, b.Serialize()})
+	sendData(addr, encodeMessage("block", payload))
+}
+
+// SendTx 把一笔交易发给 addr，getdata "tx" 请求的应答走这个函数；挖矿
+// 后的广播发的是区块 inv，不经过它。
+func SendTx(addr string, txn *transaction.Transaction) {
+	payload := gobEncode(tx{nodeAddress, *txn})
+	sendData(addr, encodeMessage("tx", payload))
+}
+
+func sendPing(addr string) {
+	payload := gobEncode(ping{nodeAddress})
+	sendData(addr, encodeMessage("ping", payload))
+}
+
+func sendPong(addr string) {
+	payload := gobEncode(pong{nodeAddress})
+	sendData(addr, encodeMessage("pong", payload))
+}
+
+// StartServer 以全节点角色启动：校验/修复本地UTXO集合、取回上次关闭
+// 前保存的内存池，监听 addr，向第一个种子节点打招呼，然后不断接受新
+// 连接并分发，直到收到终止信号时把内存池存盘再退出。addr 是监听地址，
+// 同时也是内存池落盘文件名的区分键（作为 nodeID 传给
+// mempool_persist.go），network 选择本进程使用的 magic（见
+// framing.go 的 SetNetwork）。
+func StartServer(bc *blockchain.Blockchain, addr, minerAddr, network string) {
+	nodeAddress = addr
+	miningAddress = minerAddr
+	if err := SetNetwork(network); err != nil {
+		log.Net.Println(err)
+	}
+
+	utxoSet := blockchain.UTXOSet{bc}
+	if err := blockchain.EnsureUTXOConsistency(bc, &utxoSet); err != nil {
+		log.Net.Panic(err)
+	}
+	LoadMempool(nodeAddress, bc)
+	go saveMempoolOnShutdown(nodeAddress)
+
+	ln, err := stdnet.Listen(protocol, nodeAddress)
+	if err != nil {
+		log.Net.Panic(err)
+	}
+	defer ln.Close()
+
+	if nodeAddress != knownNodes[0] {
+		sendVersion(knownNodes[0], bc)
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Net.Println(err)
+			continue
+		}
+		go handleConnection(conn, bc)
+	}
+}
+
+// saveMempoolOnShutdown 等待 SIGINT/SIGTERM，把内存池存盘后退出进程，
+// 好让下次启动时 LoadMempool 能把未确认交易找回来。
+func saveMempoolOnShutdown(nodeID string) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+	SaveMempool(nodeID)
+	os.Exit(0)
+}
+
+// handleConnection 处理一条已接受的连接：每条连接只携带一条帧封装过的
+// 消息（发送方是短连接拨号模型，见 sendData），读完、校验完并分发给
+// 对应的 handleMsg 之后就收尾，不再在同一个连接上等待下一条消息。
+func handleConnection(conn stdnet.Conn, bc *blockchain.Blockchain) {
+	defer conn.Close()
+
+	command, payload, err := readMessage(conn)
+	if err != nil {
+		log.Net.Printf("Dropping malformed message: %v\n", err)
+		return
+	}
+
+	if err := dispatch(command, payload, bc); err != nil {
+		log.Net.Printf("Rejected %s message: %v\n", command, err)
+	}
+}
+
+// dispatch 按 command 把 gob 编码的 payload 解码成对应的消息类型，再
+// 交给它自己的 handleMsg 处理。
+func dispatch(command string, payload []byte, bc *blockchain.Blockchain) error {
+	dec := gob.NewDecoder(bytes.NewReader(payload))
+
+	switch command {
+	case "version":
+		var p version
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "verack":
+		var p verack
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "getblocks":
+		var p getblocks
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "inv":
+		var p inv
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "getdata":
+		var p getdata
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "block":
+		var p block
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "tx":
+		var p tx
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "ping":
+		var p ping
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "pong":
+		var p pong
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		clearPing(p.AddrFrom)
+	case "addr":
+		var p addr
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "getaddr":
+		var p getaddr
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "filterload":
+		var p filterload
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "merkleblock":
+		var p merkleblock
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "getheaders":
+		var p getheaders
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	case "headers":
+		var p headers
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		p.handleMsg(bc, p.AddrFrom)
+	default:
+		return errors.New("server: unknown command " + command)
+	}
+
+	return nil
+}
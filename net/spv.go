@@ -0,0 +1,183 @@
+package net
+
+import (
+	"blockchain_go/blockchain"
+	"blockchain_go/log"
+	"blockchain_go/transaction"
+	"blockchain_go/wallet"
+)
+
+// peerFilters 记录每个已发送 filterload 的对等节点当前加载的Bloom过滤
+// 器。一个节点只要加载了过滤器就被当作 SPV 节点对待：block 类型的
+// getdata 请求会被 merkleblock 取代。
+var peerFilters = make(map[string]*BloomFilter)
+
+/*
+filterload消息 "这是我关心的地址，帮我按它过滤"
+
+发送条件：
+SPV节点（wallet-only）完成握手后，把自己监听的地址/公钥哈希装进一个
+Bloom过滤器发给全节点。
+
+消息处理逻辑：
+全节点记下该过滤器，之后这个对等节点的 getdata "merkleblock" 请求会
+用它来筛选匹配的交易。
+*/
+type filterload struct {
+	AddrFrom   string
+	Filter     []byte
+	NHashFuncs uint32
+	NTweak     uint32
+}
+
+func (payload *filterload) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
+	f := &BloomFilter{bits: payload.Filter, nHashFuncs: payload.NHashFuncs, nTweak: payload.NTweak}
+	peerFilters[fromAddr] = f
+	log.Net.Printf("Loaded bloom filter from SPV peer %s\n", fromAddr)
+}
+
+// matchedTxIDs 返回区块里命中 filter 的交易ID（filter为nil时视为不
+// 匹配任何交易）。
+func matchedTxIDs(block *blockchain.Block, filter *BloomFilter) [][]byte {
+	if filter == nil {
+		return nil
+	}
+
+	var matched [][]byte
+	for _, tx := range block.Transactions {
+		if txMatchesFilter(tx, filter) {
+			matched = append(matched, tx.ID)
+		}
+	}
+	return matched
+}
+
+// txMatchesFilter 检查交易的每个输入来源地址的公钥与每个输出的公钥哈希
+// 是否命中过滤器——这是BIP37里全节点为SPV对等节点做匹配的标准方式。
+func txMatchesFilter(tx *transaction.Transaction, filter *BloomFilter) bool {
+	if filter.Test(tx.ID) {
+		return true
+	}
+	for _, out := range tx.Vout {
+		if filter.Test(out.PubKeyHash) {
+			return true
+		}
+	}
+	for _, in := range tx.Vin {
+		if filter.Test(in.PubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+merkleblock消息 "这是你关心的区块头和匹配交易的梅克尔分支"
+
+发送条件：
+全节点收到 SPV 对等节点对类型为 "merkleblock" 的 getdata 请求时，用
+它代替完整的 block 消息返回。
+
+消息处理逻辑：
+SPV节点校验区块头的工作量证明链（在 headers 同步阶段已完成），再用
+随消息附带的梅克尔分支核实每个声称匹配的交易确实属于该区块。
+*/
+type merkleblock struct {
+	AddrFrom     string
+	Header       blockchain.BlockHeader
+	TotalTxs     int
+	MatchedTxIDs [][]byte
+	Proofs       [][]blockchain.MerkleProofStep
+}
+
+func (payload *merkleblock) handleMsg(bc *blockchain.Blockchain, fromAddr string) {
+	hc := getHeaderChain(bc)
+	if hc == nil {
+		log.Net.Printf("merkleblock from %s arrived before any local header chain, disconnecting\n", fromAddr)
+		disconnectPeer(fromAddr)
+		return
+	}
+
+	trusted, known := hc.Header(payload.Header.Hash)
+	if !known {
+		// 没见过这个头部，说明它没经过headers同步阶段的PoW校验：直接
+		// 信任消息自带的Header会让任何对等节点都能伪造任意的
+		// header/root/proof三元组来骗过确认，所以未知头部一律拒绝。
+		log.Net.Printf("merkleblock from %s references an unknown header %x, disconnecting\n", fromAddr, payload.Header.Hash)
+		disconnectPeer(fromAddr)
+		return
+	}
+
+	for i, txID := range payload.MatchedTxIDs {
+		if !blockchain.VerifyMerkleProof(txID, payload.Proofs[i], trusted.MerkleRoot) {
+			log.Net.Printf("merkleblock from %s failed merkle proof for tx %x, disconnecting\n", fromAddr, txID)
+			disconnectPeer(fromAddr)
+			return
+		}
+	}
+
+	log.Net.Printf("Confirmed %d watched tx(s) included in block %x\n", len(payload.MatchedTxIDs), trusted.Hash)
+}
+
+// buildMerkleBlock 为一个全节点已有的区块和请求方的过滤器组装
+// merkleblock 消息。
+func buildMerkleBlock(block *blockchain.Block, filter *BloomFilter) *merkleblock {
+	matched := matchedTxIDs(block, filter)
+
+	proofs := make([][]blockchain.MerkleProofStep, len(matched))
+	for i, txID := range matched {
+		proof, _ := block.MerkleProof(txID)
+		proofs[i] = proof
+	}
+
+	return &merkleblock{
+		AddrFrom:     nodeAddress,
+		Header:       block.Header(),
+		TotalTxs:     len(block.Transactions),
+		MatchedTxIDs: matched,
+		Proofs:       proofs,
+	}
+}
+
+// watchedAddresses 是本节点以 SPV 模式运行时，命令行 -watch 参数指定
+// 的、需要装进 filterload 的地址集合。
+var watchedAddresses []string
+
+// StartSPVNode 以 wallet/SPV 角色发起同步：用 watchAddresses 的公钥哈希
+// 构造Bloom过滤器，向每个种子节点发送 filterload 和 getheaders 后即
+// 返回。它不保存区块体或 UTXO 集，也不监听端口，因此自己收不到对方回
+// 的 headers/merkleblock；nodeID 参数不被使用，nodeAddress 也不由它设置。
+// 本仓库的 cli 没有调用它的 `startnode -spv -watch` 模式。
+func StartSPVNode(nodeID string, watchAddresses []string) {
+	watchedAddresses = watchAddresses
+
+	filter := NewBloomFilter(256, 10, newFilterTweak())
+	for _, addr := range watchAddresses {
+		filter.Add(addressToPubKeyHash(addr))
+	}
+
+	log.Net.Printf("Starting SPV node watching %d address(es)\n", len(watchAddresses))
+
+	for _, node := range knownNodes {
+		sendFilterLoad(node, filter)
+		sendGetHeaders(node)
+	}
+}
+
+// addressToPubKeyHash 把一个base58地址解码还原成它的公钥哈希：去掉版本
+// 字节和末尾4字节校验和。txMatchesFilter 测试的是 out.PubKeyHash，过滤
+// 器必须装的是同一种字节串，装地址的字面字符串永远不会命中。
+func addressToPubKeyHash(address string) []byte {
+	decoded := wallet.Base58Decode([]byte(address))
+	return decoded[1 : len(decoded)-4]
+}
+
+// newFilterTweak 由 nodeAddress 确定性地派生 nTweak：同一地址每次启动
+// 得到的 tweak 都相同，因此不能阻止别的节点跨重启比较过滤器内容。
+func newFilterTweak() uint32 {
+	var seed uint32
+	for _, c := range nodeAddress {
+		seed = seed*31 + uint32(c)
+	}
+	return seed
+}